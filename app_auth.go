@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+// appInstallationTokenSource is an oauth2.TokenSource that authenticates
+// as a GitHub App installation. It mints a short-lived RS256 JWT signed
+// with the app's private key, exchanges it for an installation access
+// token, and transparently refreshes that token before it expires.
+type appInstallationTokenSource struct {
+	appID          int64
+	installationID int64
+	privateKey     *rsa.PrivateKey
+
+	mu      sync.Mutex
+	token   *oauth2.Token
+	apiBase string
+}
+
+// newAppInstallationTokenSource reads the PEM-encoded private key at
+// keyPath and returns a TokenSource that mints installation tokens for
+// appID/installationID on demand.
+func newAppInstallationTokenSource(appID, installationID int64, keyPath string) (oauth2.TokenSource, error) {
+	raw, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading private key %s: %v", keyPath, err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", keyPath)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key %s: %v", keyPath, err)
+	}
+	return &appInstallationTokenSource{
+		appID:          appID,
+		installationID: installationID,
+		privateKey:     key,
+		apiBase:        "https://api.github.com",
+	}, nil
+}
+
+// Token implements oauth2.TokenSource, returning a cached installation
+// token and only hitting the GitHub API once the cached one is close to
+// expiry.
+func (s *appInstallationTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != nil && s.token.Expiry.After(time.Now().Add(time.Minute)) {
+		return s.token, nil
+	}
+
+	appJWT, err := s.signAppJWT()
+	if err != nil {
+		return nil, err
+	}
+
+	tok, err := s.exchangeForInstallationToken(appJWT)
+	if err != nil {
+		return nil, err
+	}
+
+	s.token = tok
+	return tok, nil
+}
+
+// signAppJWT builds and signs the short-lived JWT GitHub requires to
+// identify as the app itself (as opposed to an installation).
+func (s *appInstallationTokenSource) signAppJWT() (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iat": now.Add(-30 * time.Second).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": fmt.Sprintf("%d", s.appID),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	return token.SignedString(s.privateKey)
+}
+
+// exchangeForInstallationToken trades the app JWT for an installation
+// access token good for roughly one hour.
+func (s *appInstallationTokenSource) exchangeForInstallationToken(appJWT string) (*oauth2.Token, error) {
+	url := fmt.Sprintf("%s/app/installations/%d/access_tokens", s.apiBase, s.installationID)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(nil))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+appJWT)
+	req.Header.Set("Accept", "application/vnd.github.machine-man-preview+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("minting installation token failed: %s: %s", resp.Status, string(body))
+	}
+
+	var payload struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+	if payload.Token == "" {
+		return nil, errors.New("installation token response did not contain a token")
+	}
+
+	return &oauth2.Token{
+		AccessToken: payload.Token,
+		TokenType:   "token",
+		Expiry:      payload.ExpiresAt,
+	}, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestSignAppJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating test key: %v", err)
+	}
+
+	s := &appInstallationTokenSource{appID: 42, privateKey: key}
+
+	signed, err := s.signAppJWT()
+	if err != nil {
+		t.Fatalf("signAppJWT() error: %v", err)
+	}
+
+	claims := jwt.MapClaims{}
+	before := time.Now()
+	_, err = jwt.ParseWithClaims(signed, claims, func(*jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	})
+	if err != nil {
+		t.Fatalf("parsing signed JWT: %v", err)
+	}
+
+	if iss, _ := claims["iss"].(string); iss != fmt.Sprintf("%d", s.appID) {
+		t.Errorf("iss claim = %q, want %q", iss, fmt.Sprintf("%d", s.appID))
+	}
+
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		t.Fatalf("iat claim missing or not a number: %v", claims["iat"])
+	}
+	if iat > float64(before.Unix()) {
+		t.Errorf("iat claim %v should be at or before signing time %v (clock skew allowance)", iat, before.Unix())
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		t.Fatalf("exp claim missing or not a number: %v", claims["exp"])
+	}
+	if exp <= iat {
+		t.Errorf("exp claim %v should be after iat %v", exp, iat)
+	}
+	if exp-iat > 10*60 {
+		t.Errorf("exp-iat spread %v exceeds GitHub's 10 minute maximum", exp-iat)
+	}
+}
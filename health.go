@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// apiHealth tracks the time of the last successful GitHub API call, so
+// /readyz can report unready once ghb0t has gone too long without
+// reaching GitHub rather than only when the process itself is down.
+var apiHealth = &apiHealthTracker{}
+
+type apiHealthTracker struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// markSuccess records that a GitHub API call just succeeded.
+func (t *apiHealthTracker) markSuccess() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = time.Now()
+}
+
+// age reports how long ago the last successful call was, and whether
+// there has been one at all.
+func (t *apiHealthTracker) age() (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.last.IsZero() {
+		return 0, false
+	}
+	return time.Since(t.last), true
+}
+
+// handleHealthz reports that the process is up. It never depends on
+// GitHub reachability, so Kubernetes won't restart a pod that is merely
+// waiting out a rate limit.
+func handleHealthz(w http.ResponseWriter, req *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// handleReadyz reports ready only if a GitHub API call has succeeded
+// within readyMaxAge, so Kubernetes stops routing webhook deliveries to
+// an instance that can no longer reach GitHub.
+func handleReadyz(w http.ResponseWriter, req *http.Request) {
+	age, ok := apiHealth.age()
+	if !ok || age > readyMaxAge {
+		http.Error(w, "not ready: no recent successful GitHub API call", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
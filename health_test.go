@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestApiHealthTrackerAge(t *testing.T) {
+	tr := &apiHealthTracker{}
+
+	if _, ok := tr.age(); ok {
+		t.Error("age() should report not-ok before any success is recorded")
+	}
+
+	tr.markSuccess()
+	age, ok := tr.age()
+	if !ok {
+		t.Fatal("age() should report ok after markSuccess")
+	}
+	if age < 0 || age > time.Second {
+		t.Errorf("age() = %v, want close to 0 right after markSuccess", age)
+	}
+}
+
+func TestHandleReadyz(t *testing.T) {
+	savedHealth, savedMaxAge := apiHealth, readyMaxAge
+	defer func() { apiHealth, readyMaxAge = savedHealth, savedMaxAge }()
+	readyMaxAge = time.Minute
+
+	apiHealth = &apiHealthTracker{}
+	w := httptest.NewRecorder()
+	handleReadyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status with no recorded success = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	apiHealth.markSuccess()
+	w = httptest.NewRecorder()
+	handleReadyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status just after markSuccess = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	apiHealth.last = time.Now().Add(-2 * readyMaxAge)
+	w = httptest.NewRecorder()
+	handleReadyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status once the last success is older than readyMaxAge = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHandleHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	handleHealthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
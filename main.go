@@ -1,11 +1,9 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
 	"os/signal"
@@ -36,15 +34,39 @@ var (
 	debug   bool
 	version bool
 
-	webhook bool
+	webhook       bool
+	webhookSecret string
+
+	appID          int64
+	installationID int64
+	privateKeyPath string
+	appUsername    string
+
+	policyFile string
+	// branchPolicy is the loaded branch-deletion policy, populated once in
+	// main() before the notifier/webhook handler starts running.
+	branchPolicy *policy
+
+	stateBackend string
+	statePath    string
+	// stateStore persists lastChecked and the notifications
+	// Last-Modified watermark across restarts.
+	stateStore StateStore
+
+	rateLimitFloor int
+	maxRetries     int
+	retryBaseDelay time.Duration
+
+	shutdownGracePeriod time.Duration
+	readHeaderTimeout   time.Duration
+	writeTimeout        time.Duration
+	readyMaxAge         time.Duration
 )
 
-type event struct {
-	PullRequest *github.PullRequest `json:"pull_request"`
-	Repository  *github.Repository
-	Number      int
-	Action      string
-}
+const (
+	lastCheckedStateKey            = "lastChecked"
+	notificationsLastModifiedState = "notifications-last-modified"
+)
 
 func init() {
 	// parse flags
@@ -56,12 +78,38 @@ func init() {
 	flag.BoolVar(&debug, "d", false, "run in debug mode")
 
 	flag.BoolVar(&webhook, "webhook", false, "Handle github webhook events instead of checking for events")
+	flag.StringVar(&webhookSecret, "webhook-secret", os.Getenv("GHB0T_WEBHOOK_SECRET"), "shared secret used to verify GitHub webhook signatures")
+
+	flag.Int64Var(&appID, "app-id", 0, "GitHub App ID, to authenticate as an app installation instead of a user token")
+	flag.Int64Var(&installationID, "installation-id", 0, "GitHub App installation ID")
+	flag.StringVar(&privateKeyPath, "private-key", "", "path to the GitHub App's PEM-encoded private key")
+	flag.StringVar(&appUsername, "username", "", "login to treat as the implicit allowed owner in GitHub App mode (required with --app-id: installation tokens cannot call GET /user)")
+
+	flag.StringVar(&policyFile, "policy-file", "", "path to a YAML/JSON file describing the branch-deletion policy")
+
+	flag.StringVar(&stateBackend, "state-backend", "file", "where to persist lastChecked across restarts: file, bolt or redis")
+	flag.StringVar(&statePath, "state-path", "", "path (file/bolt) or address (redis) for --state-backend")
+
+	flag.IntVar(&rateLimitFloor, "rate-limit-floor", 100, "preemptively wait for reset once remaining GitHub API calls fall to or below this")
+	flag.IntVar(&maxRetries, "max-retries", 5, "maximum retry attempts for idempotent GitHub API requests on 5xx/network errors")
+	flag.DurationVar(&retryBaseDelay, "retry-base-delay", 500*time.Millisecond, "base delay for exponential backoff between retries")
+
+	flag.DurationVar(&shutdownGracePeriod, "shutdown-grace-period", 15*time.Second, "how long to wait for in-flight work to finish on SIGINT/SIGTERM before exiting")
+	flag.DurationVar(&readHeaderTimeout, "read-header-timeout", 5*time.Second, "webhook HTTP server ReadHeaderTimeout")
+	flag.DurationVar(&writeTimeout, "write-timeout", 10*time.Second, "webhook HTTP server WriteTimeout")
+	flag.DurationVar(&readyMaxAge, "ready-max-age", 5*time.Minute, "/readyz reports unready once the last successful GitHub API call is older than this")
 
 	flag.Usage = func() {
 		fmt.Fprint(os.Stderr, fmt.Sprintf(BANNER, VERSION))
 		flag.PrintDefaults()
 	}
+}
 
+// parseFlags parses the command line and validates/acts on the result.
+// It is called explicitly from main(), rather than from init(), so that
+// `go test` (which registers its own flags after init() runs) isn't
+// handed an os.Args it doesn't recognize.
+func parseFlags() {
 	flag.Parse()
 
 	if version {
@@ -74,41 +122,89 @@ func init() {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 
-	if token == "" {
+	if token == "" && appID == 0 {
 		usageAndExit("GitHub token cannot be empty.", 1)
 	}
+
+	if appID != 0 && (installationID == 0 || privateKeyPath == "") {
+		usageAndExit("--app-id requires both --installation-id and --private-key.", 1)
+	}
+
+	if appID != 0 && appUsername == "" {
+		usageAndExit("--app-id requires --username: installation tokens can't call GET /user to discover it.", 1)
+	}
+
+	if webhook && webhookSecret == "" {
+		usageAndExit("--webhook requires --webhook-secret/GHB0T_WEBHOOK_SECRET: without it every incoming webhook would be rejected.", 1)
+	}
 }
 
 func main() {
-	var ticker *time.Ticker
-	// On ^C, or SIGTERM handle exit.
+	parseFlags()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// On ^C, or SIGTERM, cancel ctx instead of exiting immediately, so
+	// in-flight notifications and webhook deliveries get a chance to
+	// finish within --shutdown-grace-period.
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	signal.Notify(c, syscall.SIGTERM)
 	go func() {
-		for sig := range c {
-			ticker.Stop()
-			logrus.Infof("Received %s, exiting.", sig.String())
-			os.Exit(0)
-		}
+		sig := <-c
+		logrus.Infof("Received %s, shutting down.", sig.String())
+		cancel()
 	}()
 
-	// Create the http client.
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
+	// Create the http client, either from a static PAT or, when --app-id is
+	// set, by minting and refreshing GitHub App installation tokens.
+	var ts oauth2.TokenSource
+	if appID != 0 {
+		var err error
+		ts, err = newAppInstallationTokenSource(appID, installationID, privateKeyPath)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	} else {
+		ts = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	}
 	tc := oauth2.NewClient(oauth2.NoContext, ts)
+	tc.Transport = newRateLimitTransport(tc.Transport, rateLimitFloor, maxRetries, retryBaseDelay)
 
 	// Create the github client.
 	client := github.NewClient(tc)
 
-	// Get the authenticated user, the empty string being passed let's the GitHub
-	// API know we want ourself.
-	user, _, err := client.Users.Get("")
+	// GET /user requires a user/OAuth token; installation tokens get a
+	// 403, so in App mode there is no "authenticated user" to discover
+	// and --username must be given explicitly instead.
+	var username string
+	var err error
+	if appID != 0 {
+		username = appUsername
+	} else {
+		// Get the authenticated user, the empty string being passed let's
+		// the GitHub API know we want ourself.
+		var user *github.User
+		user, _, err = client.Users.Get(ctx, "")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		username = *user.Login
+	}
+
+	branchPolicy, err = loadPolicy(policyFile)
 	if err != nil {
-		logrus.Fatal(err)
+		logrus.Fatalf("loading policy file %s: %v", policyFile, err)
+	}
+
+	stateStore, err = newStateStore(stateBackend, statePath)
+	if err != nil {
+		logrus.Fatalf("creating state store: %v", err)
+	}
+	lastChecked, err = stateStore.Get(lastCheckedStateKey)
+	if err != nil {
+		logrus.Fatalf("loading lastChecked from state store: %v", err)
 	}
-	username := *user.Login
 
 	// parse the duration
 	dur, err := time.ParseDuration(interval)
@@ -119,116 +215,176 @@ func main() {
 	logrus.Infof("Bot started for user %s.", username)
 	fmt.Println("webhook: ", webhook)
 	if webhook {
-		listenHooks(8080, client, username)
+		srv := listenHooks(8080, client, username)
+		<-ctx.Done()
+		shutdownServer(srv, "webhook")
 	} else {
-		notifier(dur, client, username)
+		srv := listenHealth(8080)
+		notifier(ctx, dur, client, username)
+		shutdownServer(srv, "health")
 	}
 }
 
-func buildHandler(client *github.Client, username string) http.HandlerFunc {
-	return func(w http.ResponseWriter, req *http.Request) {
-		b, err := ioutil.ReadAll(req.Body)
-		if err != nil {
-			logrus.Fatal("Failed to read request body")
-		}
-		evt := event{}
-		err = json.Unmarshal(b, &evt)
-
-		if err != nil {
-			logrus.Fatal("Failed to read request body")
-		}
-		if evt.PullRequest != nil {
-			if evt.Action == "closed" {
-				err = closePR(client, username, evt.PullRequest)
-				if err != nil {
-					logrus.Errorf("Failed to close PullRequest %d on %s: %s", *evt.PullRequest.Number, *evt.Repository.FullName, err.Error())
-				}
-			} else {
-				logrus.Infof("Skipping PR event, PR %d on %s state %s is not closed", *evt.PullRequest.Number, *evt.Repository.FullName, evt.Action)
-			}
-		} else {
-			logrus.Infof("Skipping non PR event %v", evt)
-		}
+// shutdownServer gives an in-flight request up to --shutdown-grace-period
+// to finish before closing srv.
+func shutdownServer(srv *http.Server, name string) {
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
+	defer shutdownCancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logrus.Warnf("Error shutting down %s server: %v", name, err)
 	}
 }
 
-func listenHooks(port int, client *github.Client, username string) {
-	http.HandleFunc("/", buildHandler(client, username))
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
-}
+func closePR(ctx context.Context, client *github.Client, username string, pr *github.PullRequest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-func closePR(client *github.Client, username string, pr *github.PullRequest) error {
-	if *pr.State == "closed" && *pr.Merged {
-		// If the PR was made from a repository owned by the current user,
-		// let's delete it.
-		branch := *pr.Head.Ref
-		if pr.Head.Repo == nil {
-			return nil
-		}
-		if pr.Head.Repo.Owner == nil {
-			return nil
-		}
-		owner := *pr.Head.Repo.Owner.Login
-		// Never delete the master branch or a branch we do not own.
-		if owner == username && branch != "master" {
-			_, err := client.Git.DeleteRef(username, *pr.Head.Repo.Name, strings.Replace("heads/"+*pr.Head.Ref, "#", "%23", -1))
-			// 422 is the error code for when the branch does not exist.
-			if err != nil && !strings.Contains(err.Error(), " 422 ") {
-				return err
-			}
-			logrus.Infof("Branch %s on %s/%s no longer exists.", branch, owner, *pr.Head.Repo.Name)
-		}
+	pol := branchPolicy
+	if pol == nil {
+		pol = defaultPolicy()
+	}
+
+	if *pr.State != "closed" {
+		return nil
+	}
+	if pol.requireMerged() && (pr.Merged == nil || !*pr.Merged) {
+		return nil
+	}
+	if pr.Head.Repo == nil || pr.Head.Repo.Owner == nil {
+		return nil
+	}
+
+	branch := *pr.Head.Ref
+	owner := *pr.Head.Repo.Owner.Login
+	repo := *pr.Head.Repo.Name
+	fullName := owner + "/" + repo
+
+	if pol.isProtectedBranch(branch) {
+		logrus.Debugf("Not deleting branch %s on %s: matches a protected_branches glob", branch, fullName)
+		return nil
+	}
+	if !pol.ownerAllowed(owner, username) {
+		logrus.Debugf("Not deleting branch %s on %s: owner %s is not allowed_owners", branch, fullName, owner)
+		return nil
+	}
+	if !pol.repoAllowed(fullName) {
+		logrus.Debugf("Not deleting branch %s on %s: repo is not allowed_repos", branch, fullName)
+		return nil
+	}
+	if pol.MinAgeBeforeDelete > 0 && pr.ClosedAt != nil && time.Since(*pr.ClosedAt) < pol.MinAgeBeforeDelete {
+		logrus.Debugf("Not deleting branch %s on %s yet: closed less than %s ago", branch, fullName, pol.MinAgeBeforeDelete)
+		return nil
+	}
+
+	protection, resp, err := client.Repositories.GetBranchProtection(ctx, owner, repo, branch)
+	if err != nil && (resp == nil || resp.StatusCode != 404) {
+		return err
+	}
+	if protection != nil {
+		logrus.Debugf("Not deleting branch %s on %s: protected on GitHub", branch, fullName)
+		return nil
 	}
+
+	_, err = client.Git.DeleteRef(ctx, owner, repo, strings.Replace("heads/"+branch, "#", "%23", -1))
+	// 422 is the error code for when the branch does not exist.
+	if err != nil && !strings.Contains(err.Error(), " 422 ") {
+		return err
+	}
+	logrus.Infof("Branch %s on %s no longer exists.", branch, fullName)
 	return nil
 }
 
-func notifier(dur time.Duration, client *github.Client, username string) {
+func notifier(ctx context.Context, dur time.Duration, client *github.Client, username string) {
 	ticker := time.NewTicker(dur)
-	for range ticker.C {
-		page := 1
-		perPage := 20
-		if err := getNotifications(client, username, page, perPage); err != nil {
-			logrus.Warn(err)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			page := 1
+			perPage := 20
+			if err := getNotifications(ctx, client, username, page, perPage); err != nil {
+				logrus.Warn(err)
+			}
 		}
 	}
 }
 
-// getNotifications iterates over all the notifications received by a user.
-func getNotifications(client *github.Client, username string, page, perPage int) error {
-	opt := &github.NotificationListOptions{
-		All:   true,
-		Since: lastChecked,
-		ListOptions: github.ListOptions{
-			Page:    page,
-			PerPage: perPage,
-		},
+// getNotifications iterates over all the notifications received by a user,
+// starting a new sweep at page. lastChecked is only advanced once the
+// whole pagination sweep completes successfully, so a restart or an
+// error mid-sweep re-scans rather than silently skipping notifications.
+func getNotifications(ctx context.Context, client *github.Client, username string, page, perPage int) error {
+	return sweepNotifications(ctx, client, username, page, perPage, time.Now())
+}
+
+func sweepNotifications(ctx context.Context, client *github.Client, username string, page, perPage int, sweepStart time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	req, err := client.NewRequest("GET", "notifications", nil)
+	if err != nil {
+		return err
 	}
-	if lastChecked.IsZero() {
-		lastChecked = time.Now()
+	q := req.URL.Query()
+	q.Set("all", "true")
+	if !lastChecked.IsZero() {
+		q.Set("since", lastChecked.Format(time.RFC3339))
 	}
+	q.Set("page", strconv.Itoa(page))
+	q.Set("per_page", strconv.Itoa(perPage))
+	req.URL.RawQuery = q.Encode()
 
-	notifications, resp, err := client.Activity.ListNotifications(opt)
+	if page == 1 {
+		if lastModified, err := stateStore.Get(notificationsLastModifiedState); err == nil && !lastModified.IsZero() {
+			req.Header.Set("If-Modified-Since", lastModified.UTC().Format(http.TimeFormat))
+		}
+	}
+
+	var notifications []*github.Notification
+	resp, err := client.Do(ctx, req, &notifications)
 	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotModified {
+			return completeSweep(sweepStart)
+		}
 		return err
 	}
 
 	for _, notification := range notifications {
 		// handle event
-		if err := handleNotification(client, notification, username); err != nil {
+		if err := handleNotification(ctx, client, notification, username); err != nil {
 			return err
 		}
 	}
 
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		if t, err := time.Parse(http.TimeFormat, lastModified); err == nil {
+			if err := stateStore.Set(notificationsLastModifiedState, t); err != nil {
+				logrus.Warnf("persisting notifications Last-Modified: %v", err)
+			}
+		}
+	}
+
 	// Return early if we are on the last page.
 	if page == resp.LastPage || resp.NextPage == 0 {
-		return nil
+		return completeSweep(sweepStart)
 	}
 
-	page = resp.NextPage
-	return getNotifications(client, username, page, perPage)
+	return sweepNotifications(ctx, client, username, resp.NextPage, perPage, sweepStart)
+}
+
+// completeSweep advances lastChecked to sweepStart now that a full
+// pagination sweep has finished without error, and persists it so a
+// restart picks up where this sweep left off rather than from zero.
+func completeSweep(sweepStart time.Time) error {
+	lastChecked = sweepStart
+	return stateStore.Set(lastCheckedStateKey, sweepStart)
 }
 
-func handleNotification(client *github.Client, notification *github.Notification, username string) error {
+func handleNotification(ctx context.Context, client *github.Client, notification *github.Notification, username string) error {
 	// Check if the type is a pull request.
 	if *notification.Subject.Type == "PullRequest" {
 		// Let's get some information about the pull request.
@@ -238,11 +394,11 @@ func handleNotification(client *github.Client, notification *github.Notification
 		if err != nil {
 			return err
 		}
-		pr, _, err := client.PullRequests.Get(*notification.Repository.Owner.Login, *notification.Repository.Name, int(id))
+		pr, _, err := client.PullRequests.Get(ctx, *notification.Repository.Owner.Login, *notification.Repository.Name, int(id))
 		if err != nil {
 			return err
 		}
-		return closePR(client, username, pr)
+		return closePR(ctx, client, username, pr)
 
 	}
 	return nil
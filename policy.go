@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// defaultProtectedBranches is used when a policy file does not set
+// protected_branches at all.
+var defaultProtectedBranches = []string{"master", "main", "develop", "release/*"}
+
+// policy describes when ghb0t is allowed to delete a pull request's head
+// branch after it has been closed. It is loaded from a YAML or JSON file
+// via --policy-file so the same binary can be run safely across personal
+// forks and shared org repos.
+type policy struct {
+	// ProtectedBranches lists glob patterns (matched with path.Match) of
+	// branch names that must never be deleted, regardless of ownership.
+	ProtectedBranches []string `json:"protected_branches" yaml:"protected_branches"`
+	// AllowedOwners restricts deletion to branches whose head repo is
+	// owned by one of these logins. Empty means "the authenticated user
+	// only", matching the historical behavior.
+	AllowedOwners []string `json:"allowed_owners" yaml:"allowed_owners"`
+	// AllowedRepos, when non-empty, restricts deletion to these
+	// "owner/name" repositories.
+	AllowedRepos []string `json:"allowed_repos" yaml:"allowed_repos"`
+	// MinAgeBeforeDelete requires the PR to have been closed for at
+	// least this long before its branch is cleaned up.
+	MinAgeBeforeDelete time.Duration `json:"min_age_before_delete" yaml:"min_age_before_delete"`
+	// RequireMerged, when true (the default), only deletes branches of
+	// merged PRs. When false, branches of closed-but-unmerged PRs are
+	// also cleaned up.
+	RequireMerged *bool `json:"require_merged" yaml:"require_merged"`
+}
+
+// UnmarshalJSON customizes decoding so MinAgeBeforeDelete accepts a
+// duration string (e.g. "24h"), the same syntax yaml.v2 already
+// supports for time.Duration fields. encoding/json has no such special
+// case on its own, so without this a JSON policy file using that syntax
+// would fail to parse. Plain numeric nanoseconds still work too.
+func (p *policy) UnmarshalJSON(data []byte) error {
+	type alias policy
+	aux := &struct {
+		MinAgeBeforeDelete json.RawMessage `json:"min_age_before_delete"`
+		*alias
+	}{alias: (*alias)(p)}
+
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+	if len(aux.MinAgeBeforeDelete) == 0 {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(aux.MinAgeBeforeDelete, &s); err == nil {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("parsing min_age_before_delete %q: %v", s, err)
+		}
+		p.MinAgeBeforeDelete = d
+		return nil
+	}
+
+	var ns int64
+	if err := json.Unmarshal(aux.MinAgeBeforeDelete, &ns); err != nil {
+		return fmt.Errorf("min_age_before_delete must be a duration string (e.g. \"24h\") or a number of nanoseconds: %v", err)
+	}
+	p.MinAgeBeforeDelete = time.Duration(ns)
+	return nil
+}
+
+// defaultPolicy reproduces ghb0t's historical, hard-coded behavior: never
+// touch master, and only delete branches owned by the authenticated user.
+func defaultPolicy() *policy {
+	t := true
+	return &policy{
+		ProtectedBranches: defaultProtectedBranches,
+		RequireMerged:     &t,
+	}
+}
+
+// loadPolicy reads and parses a policy file. An empty path returns
+// defaultPolicy(). The format (YAML or JSON) is chosen from the file
+// extension, defaulting to YAML.
+func loadPolicy(path string) (*policy, error) {
+	if path == "" {
+		return defaultPolicy(), nil
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := defaultPolicy()
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(raw, p)
+	} else {
+		err = yaml.Unmarshal(raw, p)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.ProtectedBranches) == 0 {
+		p.ProtectedBranches = defaultProtectedBranches
+	}
+	if p.RequireMerged == nil {
+		t := true
+		p.RequireMerged = &t
+	}
+
+	return p, nil
+}
+
+// requireMerged reports whether only merged PRs should have their branch
+// cleaned up.
+func (p *policy) requireMerged() bool {
+	return p.RequireMerged == nil || *p.RequireMerged
+}
+
+// isProtectedBranch reports whether branch matches one of the
+// policy's protected branch globs.
+func (p *policy) isProtectedBranch(branch string) bool {
+	for _, pattern := range p.ProtectedBranches {
+		if ok, _ := filepath.Match(pattern, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ownerAllowed reports whether owner is allowed to have its branches
+// deleted. An empty AllowedOwners list falls back to "only the
+// authenticated user", matching ghb0t's historical behavior.
+func (p *policy) ownerAllowed(owner, username string) bool {
+	if len(p.AllowedOwners) == 0 {
+		return owner == username
+	}
+	for _, allowed := range p.AllowedOwners {
+		if allowed == owner {
+			return true
+		}
+	}
+	return false
+}
+
+// repoAllowed reports whether the "owner/name" repo is allowed to have
+// its branches deleted. An empty AllowedRepos list allows any repo.
+func (p *policy) repoAllowed(fullName string) bool {
+	if len(p.AllowedRepos) == 0 {
+		return true
+	}
+	for _, allowed := range p.AllowedRepos {
+		if allowed == fullName {
+			return true
+		}
+	}
+	return false
+}
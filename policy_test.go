@@ -0,0 +1,148 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPolicyIsProtectedBranch(t *testing.T) {
+	p := &policy{ProtectedBranches: []string{"master", "release/*"}}
+
+	cases := map[string]bool{
+		"master":       true,
+		"release/v1.2": true,
+		"feature/foo":  false,
+	}
+	for branch, want := range cases {
+		if got := p.isProtectedBranch(branch); got != want {
+			t.Errorf("isProtectedBranch(%q) = %v, want %v", branch, got, want)
+		}
+	}
+}
+
+func TestPolicyOwnerAllowed(t *testing.T) {
+	// Empty AllowedOwners falls back to "authenticated user only".
+	p := &policy{}
+	if !p.ownerAllowed("me", "me") {
+		t.Error("ownerAllowed should default to allowing the authenticated user")
+	}
+	if p.ownerAllowed("someone-else", "me") {
+		t.Error("ownerAllowed should default to denying everyone else")
+	}
+
+	p = &policy{AllowedOwners: []string{"org-a", "org-b"}}
+	if !p.ownerAllowed("org-b", "me") {
+		t.Error("ownerAllowed should allow a listed owner")
+	}
+	if p.ownerAllowed("me", "me") {
+		t.Error("a non-empty AllowedOwners should no longer implicitly allow the authenticated user")
+	}
+}
+
+func TestPolicyRepoAllowed(t *testing.T) {
+	p := &policy{}
+	if !p.repoAllowed("anyone/anything") {
+		t.Error("an empty AllowedRepos should allow any repo")
+	}
+
+	p = &policy{AllowedRepos: []string{"org/repo"}}
+	if !p.repoAllowed("org/repo") {
+		t.Error("repoAllowed should allow a listed repo")
+	}
+	if p.repoAllowed("org/other") {
+		t.Error("repoAllowed should deny an unlisted repo")
+	}
+}
+
+func TestLoadPolicyJSONDurationString(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ghb0t-policy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.json")
+	body := `{"protected_branches": ["master"], "min_age_before_delete": "24h"}`
+	if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := loadPolicy(path)
+	if err != nil {
+		t.Fatalf("loadPolicy() error: %v", err)
+	}
+	if p.MinAgeBeforeDelete != 24*time.Hour {
+		t.Errorf("MinAgeBeforeDelete = %v, want 24h", p.MinAgeBeforeDelete)
+	}
+}
+
+func TestLoadPolicyJSONDurationNanoseconds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ghb0t-policy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.json")
+	body := `{"min_age_before_delete": 3600000000000}`
+	if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := loadPolicy(path)
+	if err != nil {
+		t.Fatalf("loadPolicy() error: %v", err)
+	}
+	if p.MinAgeBeforeDelete != time.Hour {
+		t.Errorf("MinAgeBeforeDelete = %v, want 1h", p.MinAgeBeforeDelete)
+	}
+}
+
+func TestLoadPolicyYAML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ghb0t-policy-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.yaml")
+	body := "protected_branches: [master, release/*]\n" +
+		"allowed_owners: [org-a]\n" +
+		"min_age_before_delete: 24h\n"
+	if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := loadPolicy(path)
+	if err != nil {
+		t.Fatalf("loadPolicy() error: %v", err)
+	}
+	if !p.isProtectedBranch("release/v1.2") {
+		t.Error("expected protected_branches from the YAML file to be loaded")
+	}
+	if !p.ownerAllowed("org-a", "me") {
+		t.Error("expected allowed_owners from the YAML file to be loaded")
+	}
+	if p.MinAgeBeforeDelete != 24*time.Hour {
+		t.Errorf("MinAgeBeforeDelete = %v, want 24h", p.MinAgeBeforeDelete)
+	}
+}
+
+func TestLoadPolicyEmptyPathReturnsDefault(t *testing.T) {
+	p, err := loadPolicy("")
+	if err != nil {
+		t.Fatalf("loadPolicy(\"\") error: %v", err)
+	}
+	if !p.requireMerged() {
+		t.Error("default policy should require merged PRs")
+	}
+	if !p.isProtectedBranch("master") {
+		t.Error("default policy should protect master")
+	}
+}
+
+func TestLoadPolicyMissingFile(t *testing.T) {
+	if _, err := loadPolicy(filepath.Join(os.TempDir(), "does-not-exist-ghb0t-policy.yaml")); err == nil {
+		t.Error("expected an error for a missing policy file")
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	rateLimitRetriesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ghb0t_github_retries_total",
+		Help: "Number of GitHub API requests that were retried after a network error or a 5xx response.",
+	})
+	rateLimitWaitsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ghb0t_github_rate_limit_waits_total",
+		Help: "Number of times ghb0t paused a request to respect GitHub's primary or secondary rate limits.",
+	})
+	rateLimitRemaining = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ghb0t_github_rate_limit_remaining",
+		Help: "Remaining GitHub API calls in the current primary rate-limit window, as last reported by the API.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(rateLimitRetriesTotal, rateLimitWaitsTotal, rateLimitRemaining)
+}
+
+// rateLimitTransport wraps an http.RoundTripper so that calls against the
+// GitHub API (1) block preemptively once the primary rate limit budget
+// drops below floor, (2) honor secondary/abuse Retry-After responses, and
+// (3) retry idempotent GET requests on 5xx and network errors with
+// exponential backoff and jitter, up to maxRetries attempts.
+type rateLimitTransport struct {
+	next       http.RoundTripper
+	floor      int
+	maxRetries int
+	baseDelay  time.Duration
+
+	mu        sync.Mutex
+	remaining int
+	resetAt   time.Time
+}
+
+func newRateLimitTransport(next http.RoundTripper, floor, maxRetries int, baseDelay time.Duration) *rateLimitTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &rateLimitTransport{
+		next:       next,
+		floor:      floor,
+		maxRetries: maxRetries,
+		baseDelay:  baseDelay,
+	}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if err := t.waitForBudget(ctx); err != nil {
+		return nil, err
+	}
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		resp, err = t.next.RoundTrip(req)
+		t.recordLimits(resp)
+		// Only a genuine 2xx counts towards /readyz: a 4xx/5xx means the
+		// round trip reached GitHub but the call itself failed, which is
+		// exactly the condition /readyz exists to catch (e.g. during a
+		// GitHub-side outage). Marking it here (rather than at individual
+		// API call sites) means every successful GitHub call, across
+		// every feature, keeps readiness fresh.
+		if isSuccess(resp) {
+			apiHealth.markSuccess()
+		}
+
+		if resp != nil && isSecondaryRateLimit(resp) {
+			if attempt >= t.maxRetries {
+				return resp, err
+			}
+			rateLimitWaitsTotal.Inc()
+			sleep := retryAfterDelay(resp, t.baseDelay)
+			logrus.Warnf("GitHub secondary rate limit hit, sleeping %s (attempt %d/%d)", sleep, attempt+1, t.maxRetries)
+			drainAndClose(resp)
+			if err := sleepContext(ctx, sleep); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !shouldRetry(req, resp, err) || attempt >= t.maxRetries {
+			return resp, err
+		}
+
+		rateLimitRetriesTotal.Inc()
+		drainAndClose(resp)
+		delay := backoffWithJitter(t.baseDelay, attempt)
+		logrus.Warnf("Retrying %s %s (attempt %d/%d) in %s: %v", req.Method, req.URL, attempt+1, t.maxRetries, delay, err)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitForBudget blocks until the primary rate limit window resets if the
+// last observed remaining budget was at or below floor.
+func (t *rateLimitTransport) waitForBudget(ctx context.Context) error {
+	t.mu.Lock()
+	remaining, resetAt := t.remaining, t.resetAt
+	t.mu.Unlock()
+
+	if remaining > t.floor || resetAt.IsZero() {
+		return nil
+	}
+	if wait := time.Until(resetAt); wait > 0 {
+		rateLimitWaitsTotal.Inc()
+		logrus.Warnf("GitHub rate limit budget (%d) at or below floor (%d), waiting %s for reset", remaining, t.floor, wait)
+		return sleepContext(ctx, wait)
+	}
+	return nil
+}
+
+// sleepContext sleeps for d, returning early with ctx.Err() if ctx is
+// canceled first, so a caller's shutdown context can interrupt a
+// retry/backoff wait instead of blocking it indefinitely.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (t *rateLimitTransport) recordLimits(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	resetUnix, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.remaining = remaining
+	t.resetAt = time.Unix(resetUnix, 0)
+	t.mu.Unlock()
+
+	rateLimitRemaining.Set(float64(remaining))
+}
+
+// isSuccess reports whether resp is a genuine 2xx response.
+func isSuccess(resp *http.Response) bool {
+	return resp != nil && resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// isSecondaryRateLimit reports whether resp is GitHub's abuse/secondary
+// rate limit response, identified by a Retry-After header.
+func isSecondaryRateLimit(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusForbidden && resp.Header.Get("Retry-After") != ""
+}
+
+func retryAfterDelay(resp *http.Response, fallback time.Duration) time.Duration {
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return fallback
+}
+
+// shouldRetry only retries idempotent GET requests, and only on network
+// errors or 5xx responses.
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp != nil && resp.StatusCode >= 500
+}
+
+func backoffWithJitter(base time.Duration, attempt int) time.Duration {
+	backoff := base << uint(attempt)
+	jitter := time.Duration(rand.Int63n(int64(base) + 1))
+	return backoff + jitter
+}
+
+func drainAndClose(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	resp.Body.Close()
+}
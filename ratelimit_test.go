@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestShouldRetry(t *testing.T) {
+	get, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	post, _ := http.NewRequest(http.MethodPost, "http://example.com", nil)
+
+	resp500 := &http.Response{StatusCode: 500}
+	resp200 := &http.Response{StatusCode: 200}
+
+	cases := []struct {
+		name string
+		req  *http.Request
+		resp *http.Response
+		err  error
+		want bool
+	}{
+		{"GET network error", get, nil, errors.New("boom"), true},
+		{"GET 5xx", get, resp500, nil, true},
+		{"GET 2xx", get, resp200, nil, false},
+		{"POST network error is not retried", post, nil, errors.New("boom"), false},
+		{"POST 5xx is not retried", post, resp500, nil, false},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldRetry(tt.req, tt.resp, tt.err); got != tt.want {
+				t.Errorf("shouldRetry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSuccess(t *testing.T) {
+	if isSuccess(nil) {
+		t.Error("a nil response should not be treated as success")
+	}
+	if !isSuccess(&http.Response{StatusCode: 200}) {
+		t.Error("200 should be treated as success")
+	}
+	if isSuccess(&http.Response{StatusCode: 404}) {
+		t.Error("404 should not be treated as success")
+	}
+	if isSuccess(&http.Response{StatusCode: 500}) {
+		t.Error("500 should not be treated as success")
+	}
+}
+
+func TestRoundTripOnlyMarksHealthOnSuccess(t *testing.T) {
+	saved := apiHealth
+	defer func() { apiHealth = saved }()
+	apiHealth = &apiHealthTracker{}
+
+	inner := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		rec := httptest.NewRecorder()
+		rec.WriteHeader(http.StatusInternalServerError)
+		return rec.Result(), nil
+	})
+	transport := newRateLimitTransport(inner, 0, 0, time.Millisecond)
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com", nil)
+
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip() error: %v", err)
+	}
+	if _, ok := apiHealth.age(); ok {
+		t.Error("a 500 response should not mark apiHealth as successful")
+	}
+}
+
+func TestIsSecondaryRateLimit(t *testing.T) {
+	if !isSecondaryRateLimit(&http.Response{StatusCode: http.StatusForbidden, Header: http.Header{"Retry-After": []string{"30"}}}) {
+		t.Error("expected 403 with Retry-After to be a secondary rate limit")
+	}
+	if isSecondaryRateLimit(&http.Response{StatusCode: http.StatusForbidden, Header: http.Header{}}) {
+		t.Error("a bare 403 without Retry-After should not be treated as a secondary rate limit")
+	}
+	if isSecondaryRateLimit(&http.Response{StatusCode: http.StatusOK, Header: http.Header{"Retry-After": []string{"30"}}}) {
+		t.Error("a 200 should never be treated as a secondary rate limit")
+	}
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"5"}}}
+	if got := retryAfterDelay(resp, time.Second); got != 5*time.Second {
+		t.Errorf("retryAfterDelay() = %v, want 5s", got)
+	}
+
+	resp = &http.Response{Header: http.Header{}}
+	if got := retryAfterDelay(resp, 2*time.Second); got != 2*time.Second {
+		t.Errorf("retryAfterDelay() with no header = %v, want fallback 2s", got)
+	}
+}
+
+func TestBackoffWithJitter(t *testing.T) {
+	base := 100 * time.Millisecond
+	for attempt := 0; attempt < 4; attempt++ {
+		min := base << uint(attempt)
+		max := min + base
+		d := backoffWithJitter(base, attempt)
+		if d < min || d > max {
+			t.Errorf("backoffWithJitter(base, %d) = %v, want in [%v, %v]", attempt, d, min, max)
+		}
+	}
+}
+
+func TestSleepContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sleepContext(ctx, time.Minute); err == nil {
+		t.Error("sleepContext should return immediately with an error on an already-canceled context")
+	}
+}
+
+func TestRoundTripCapsSecondaryRateLimitRetries(t *testing.T) {
+	attempts := 0
+	inner := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Retry-After", "0")
+		rec.WriteHeader(http.StatusForbidden)
+		return rec.Result(), nil
+	})
+
+	transport := newRateLimitTransport(inner, 0, 2, time.Millisecond)
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error: %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("resp.StatusCode = %d, want 403", resp.StatusCode)
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3 (initial + maxRetries)", attempts)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
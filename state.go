@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	redis "gopkg.in/redis.v5"
+)
+
+// StateStore persists small pieces of state, keyed by name, across ghb0t
+// restarts. It currently only needs to hold timestamps (lastChecked and
+// the notifications Last-Modified watermark), so the interface stays
+// narrow on purpose.
+type StateStore interface {
+	Get(key string) (time.Time, error)
+	Set(key string, t time.Time) error
+}
+
+// newStateStore builds the StateStore selected by --state-backend,
+// rooted at --state-path.
+func newStateStore(backend, path string) (StateStore, error) {
+	switch backend {
+	case "", "file":
+		return newFileStateStore(path), nil
+	case "bolt":
+		return newBoltStateStore(path)
+	case "redis":
+		return newRedisStateStore(path), nil
+	default:
+		return nil, fmt.Errorf("unknown --state-backend %q (want file, bolt or redis)", backend)
+	}
+}
+
+// fileStateStore persists state as a single JSON file of key -> RFC3339
+// timestamp. It is intentionally simple: the whole file is read and
+// rewritten on every Set, which is more than fine for ghb0t's handful of
+// keys.
+type fileStateStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func newFileStateStore(path string) *fileStateStore {
+	if path == "" {
+		path = "ghb0t-state.json"
+	}
+	return &fileStateStore{path: path}
+}
+
+func (s *fileStateStore) read() (map[string]time.Time, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return map[string]time.Time{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := map[string]time.Time{}
+	if len(data) == 0 {
+		return state, nil
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (s *fileStateStore) Get(key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.read()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return state[key], nil
+}
+
+func (s *fileStateStore) Set(key string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.read()
+	if err != nil {
+		return err
+	}
+	state[key] = t
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, data, 0644)
+}
+
+// boltStateStore persists state in a single BoltDB bucket, one key per
+// entry, values formatted as RFC3339.
+type boltStateStore struct {
+	db *bolt.DB
+}
+
+var boltBucket = []byte("ghb0t")
+
+func newBoltStateStore(path string) (*boltStateStore, error) {
+	if path == "" {
+		path = "ghb0t-state.db"
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &boltStateStore{db: db}, nil
+}
+
+func (s *boltStateStore) Get(key string) (time.Time, error) {
+	var t time.Time
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltBucket).Get([]byte(key))
+		if len(v) == 0 {
+			return nil
+		}
+		parsed, err := time.Parse(time.RFC3339, string(v))
+		if err != nil {
+			return err
+		}
+		t = parsed
+		return nil
+	})
+	return t, err
+}
+
+func (s *boltStateStore) Set(key string, t time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), []byte(t.Format(time.RFC3339)))
+	})
+}
+
+// redisStateStore persists state as string keys, prefixed to avoid
+// colliding with unrelated data in a shared Redis instance.
+type redisStateStore struct {
+	client *redis.Client
+}
+
+const redisKeyPrefix = "ghb0t:state:"
+
+func newRedisStateStore(addr string) *redisStateStore {
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	return &redisStateStore{client: redis.NewClient(&redis.Options{Addr: addr})}
+}
+
+func (s *redisStateStore) Get(key string) (time.Time, error) {
+	v, err := s.client.Get(redisKeyPrefix + key).Result()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func (s *redisStateStore) Set(key string, t time.Time) error {
+	return s.client.Set(redisKeyPrefix+key, t.Format(time.RFC3339), 0).Err()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStateStoreGetSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ghb0t-state-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := newFileStateStore(filepath.Join(dir, "state.json"))
+
+	got, err := s.Get("lastChecked")
+	if err != nil {
+		t.Fatalf("Get() on an unset key error: %v", err)
+	}
+	if !got.IsZero() {
+		t.Errorf("Get() on an unset key = %v, want zero time", got)
+	}
+
+	want := time.Now().Truncate(time.Second).UTC()
+	if err := s.Set("lastChecked", want); err != nil {
+		t.Fatalf("Set() error: %v", err)
+	}
+
+	got, err = s.Get("lastChecked")
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("Get() = %v, want %v", got, want)
+	}
+}
+
+func TestFileStateStorePersistsAcrossInstances(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ghb0t-state-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	want := time.Now().Truncate(time.Second).UTC()
+	if err := newFileStateStore(path).Set("lastChecked", want); err != nil {
+		t.Fatalf("Set() error: %v", err)
+	}
+
+	got, err := newFileStateStore(path).Get("lastChecked")
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("Get() on a fresh fileStateStore = %v, want %v", got, want)
+	}
+}
+
+func TestNewStateStoreUnknownBackend(t *testing.T) {
+	if _, err := newStateStore("carrier-pigeon", ""); err == nil {
+		t.Error("expected an error for an unknown --state-backend")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/google/go-github/github"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// eventHandler processes a single webhook delivery of a known type. body is
+// the raw, already signature-verified JSON payload.
+type eventHandler func(ctx context.Context, client *github.Client, username string, body []byte) error
+
+// errBadPayload marks an error as caused by a malformed or unexpectedly
+// shaped webhook payload, so buildHandler can answer 400 instead of the
+// 500 it uses for downstream (e.g. GitHub API) failures.
+type errBadPayload struct {
+	err error
+}
+
+func (e *errBadPayload) Error() string { return e.err.Error() }
+func (e *errBadPayload) Unwrap() error { return e.err }
+
+// eventHandlers maps the X-GitHub-Event header value to the handler
+// responsible for it. New event types are supported by registering a new
+// entry here, without touching the HTTP layer.
+var eventHandlers = map[string]eventHandler{
+	"pull_request": handlePullRequestEvent,
+	"push":         handlePushEvent,
+	"delete":       handleDeleteEvent,
+}
+
+func buildHandler(client *github.Client, username string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		if !verifyWebhookSignature(req, b, webhookSecret) {
+			logrus.Warn("Rejecting webhook request with missing or invalid signature")
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		eventType := req.Header.Get("X-GitHub-Event")
+		handler, ok := eventHandlers[eventType]
+		if !ok {
+			logrus.Infof("Skipping unsupported event type %q", eventType)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if err := handler(req.Context(), client, username, b); err != nil {
+			var bad *errBadPayload
+			if errors.As(err, &bad) {
+				http.Error(w, fmt.Sprintf("malformed %s payload: %v", eventType, bad.err), http.StatusBadRequest)
+				return
+			}
+			logrus.Errorf("Failed to handle %s event: %v", eventType, err)
+			http.Error(w, fmt.Sprintf("failed to handle %s event", eventType), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func handlePullRequestEvent(ctx context.Context, client *github.Client, username string, body []byte) error {
+	evt := github.PullRequestEvent{}
+	if err := json.Unmarshal(body, &evt); err != nil {
+		return &errBadPayload{err}
+	}
+
+	if evt.Action == nil || *evt.Action != "closed" {
+		logrus.Infof("Skipping PR event, PR %d on %s action %v is not closed", evt.GetNumber(), evt.Repo.GetFullName(), evt.Action)
+		return nil
+	}
+
+	if err := closePR(ctx, client, username, evt.PullRequest); err != nil {
+		return fmt.Errorf("closing PR %d on %s: %v", evt.GetNumber(), evt.Repo.GetFullName(), err)
+	}
+	return nil
+}
+
+func handlePushEvent(ctx context.Context, client *github.Client, username string, body []byte) error {
+	evt := github.PushEvent{}
+	if err := json.Unmarshal(body, &evt); err != nil {
+		return &errBadPayload{err}
+	}
+	logrus.Infof("Received push event on %s ref %s", evt.Repo.GetFullName(), evt.GetRef())
+	return nil
+}
+
+func handleDeleteEvent(ctx context.Context, client *github.Client, username string, body []byte) error {
+	evt := github.DeleteEvent{}
+	if err := json.Unmarshal(body, &evt); err != nil {
+		return &errBadPayload{err}
+	}
+	logrus.Infof("Received delete event on %s ref %s", evt.Repo.GetFullName(), evt.GetRef())
+	return nil
+}
+
+// registerHealthRoutes adds /healthz, /readyz and /metrics to mux, for
+// Kubernetes liveness/readiness probes and Prometheus scraping. Both
+// --webhook and notifier mode serve these, since either one is a valid
+// long-running deployment that needs a probe target.
+func registerHealthRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", handleReadyz)
+	mux.Handle("/metrics", promhttp.Handler())
+}
+
+// listenHooks starts the webhook HTTP server in the background and
+// returns it so the caller can Shutdown it gracefully. Besides the
+// webhook path itself, it serves the health/metrics routes.
+func listenHooks(port int, client *github.Client, username string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", buildHandler(client, username))
+	registerHealthRoutes(mux)
+	return startServer(port, mux)
+}
+
+// listenHealth starts a health/metrics-only HTTP server in the
+// background and returns it so the caller can Shutdown it gracefully.
+// It is used in notifier mode, which has no webhook path to serve but
+// still needs a liveness/readiness probe target.
+func listenHealth(port int) *http.Server {
+	mux := http.NewServeMux()
+	registerHealthRoutes(mux)
+	return startServer(port, mux)
+}
+
+func startServer(port int, mux *http.ServeMux) *http.Server {
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout:      writeTimeout,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.Fatalf("HTTP server: %v", err)
+		}
+	}()
+	return srv
+}
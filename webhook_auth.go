@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+)
+
+// verifyWebhookSignature checks the X-Hub-Signature-256 (preferred) or
+// X-Hub-Signature header of a GitHub webhook request against body, using
+// secret as the shared HMAC key. It returns false when neither header is
+// present, malformed, or does not match, and also when secret is empty:
+// an unconfigured secret must never be treated as a wildcard that lets
+// anyone forge a valid signature.
+func verifyWebhookSignature(req *http.Request, body []byte, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	if sig := req.Header.Get("X-Hub-Signature-256"); sig != "" {
+		return checkSignature(sig, "sha256=", sha256.New, body, secret)
+	}
+	if sig := req.Header.Get("X-Hub-Signature"); sig != "" {
+		return checkSignature(sig, "sha1=", sha1.New, body, secret)
+	}
+	return false
+}
+
+func checkSignature(header, prefix string, newHash func() hash.Hash, body []byte, secret string) bool {
+	if len(header) <= len(prefix) || header[:len(prefix)] != prefix {
+		return false
+	}
+	expected, err := hex.DecodeString(header[len(prefix):])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(expected, mac.Sum(nil))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func sha256Signature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func sha1Signature(secret string, body []byte) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write(body)
+	return "sha1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	secret := "s3cr3t"
+	body := []byte(`{"action":"closed"}`)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{
+			name:    "valid sha256",
+			headers: map[string]string{"X-Hub-Signature-256": sha256Signature(secret, body)},
+			want:    true,
+		},
+		{
+			name:    "valid sha1 fallback",
+			headers: map[string]string{"X-Hub-Signature": sha1Signature(secret, body)},
+			want:    true,
+		},
+		{
+			name:    "sha256 preferred over mismatched sha1",
+			headers: map[string]string{"X-Hub-Signature-256": sha256Signature(secret, body), "X-Hub-Signature": sha1Signature("wrong", body)},
+			want:    true,
+		},
+		{
+			name:    "wrong secret",
+			headers: map[string]string{"X-Hub-Signature-256": sha256Signature("wrong-secret", body)},
+			want:    false,
+		},
+		{
+			name:    "malformed header",
+			headers: map[string]string{"X-Hub-Signature-256": "not-hex"},
+			want:    false,
+		},
+		{
+			name:    "missing prefix",
+			headers: map[string]string{"X-Hub-Signature-256": hex.EncodeToString([]byte("abc"))},
+			want:    false,
+		},
+		{
+			name:    "no signature headers at all",
+			headers: map[string]string{},
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := verifyWebhookSignature(req, body, secret); got != tt.want {
+				t.Errorf("verifyWebhookSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyWebhookSignatureEmptySecret(t *testing.T) {
+	body := []byte(`{"action":"closed"}`)
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	// A signature computed against the empty-string key, exactly what
+	// anyone could reproduce locally if an unconfigured secret were
+	// accepted as a valid HMAC key.
+	req.Header.Set("X-Hub-Signature-256", sha256Signature("", body))
+
+	if verifyWebhookSignature(req, body, "") {
+		t.Error("verifyWebhookSignature should always return false when secret is empty")
+	}
+}
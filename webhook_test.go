@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+const testWebhookSecret = "s3cr3t"
+
+func newTestClient(serverURL string) *github.Client {
+	client := github.NewClient(nil)
+	base, _ := url.Parse(serverURL + "/")
+	client.BaseURL = base
+	return client
+}
+
+// signedRequest builds a POST request carrying body as its payload and a
+// valid X-Hub-Signature-256 for testWebhookSecret, so tests exercise
+// buildHandler past signature verification.
+func signedRequest(eventType, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("X-GitHub-Event", eventType)
+	req.Header.Set("X-Hub-Signature-256", sha256Signature(testWebhookSecret, []byte(body)))
+	return req
+}
+
+func TestBuildHandlerInvalidSignature(t *testing.T) {
+	webhookSecret = "s3cr3t"
+	defer func() { webhookSecret = "" }()
+
+	handler := buildHandler(newTestClient(""), "me")
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set("X-Hub-Signature-256", "sha256=wrong")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestBuildHandlerUnsupportedEventType(t *testing.T) {
+	webhookSecret = testWebhookSecret
+	defer func() { webhookSecret = "" }()
+
+	handler := buildHandler(newTestClient(""), "me")
+	w := httptest.NewRecorder()
+	handler(w, signedRequest("issues", `{}`))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestBuildHandlerMalformedPayloadIs400(t *testing.T) {
+	webhookSecret = testWebhookSecret
+	defer func() { webhookSecret = "" }()
+
+	handler := buildHandler(newTestClient(""), "me")
+	w := httptest.NewRecorder()
+	handler(w, signedRequest("push", `{"ref": `))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestBuildHandlerDownstreamFailureIs500(t *testing.T) {
+	webhookSecret = testWebhookSecret
+	defer func() { webhookSecret = "" }()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	handler := buildHandler(newTestClient(srv.URL), "me")
+	body := `{
+		"action": "closed",
+		"number": 1,
+		"pull_request": {
+			"state": "closed",
+			"merged": true,
+			"head": {
+				"ref": "feature/foo",
+				"repo": {"name": "repo", "owner": {"login": "me"}}
+			}
+		}
+	}`
+	w := httptest.NewRecorder()
+	handler(w, signedRequest("pull_request", body))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestBuildHandlerPushEventOK(t *testing.T) {
+	webhookSecret = testWebhookSecret
+	defer func() { webhookSecret = "" }()
+
+	handler := buildHandler(newTestClient(""), "me")
+	w := httptest.NewRecorder()
+	handler(w, signedRequest("push", `{"ref": "refs/heads/master"}`))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+}